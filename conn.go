@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Role identifies which side of a CPace exchange a peer plays when using
+// Handshake or NewConn: the initiator calls Start, the responder calls
+// Exchange.
+type Role bool
+
+const (
+	// RoleInitiator is the party that calls Start.
+	RoleInitiator Role = false
+	// RoleResponder is the party that calls Exchange.
+	RoleResponder Role = true
+)
+
+const maxFrameLen = 1<<16 - 1
+
+// writeFrame writes b to w prefixed with its length as a 2-byte big-endian
+// integer, the same framing used by TLS records.
+func writeFrame(w io.Writer, b []byte) error {
+	if len(b) > maxFrameLen {
+		return errors.New("cpace: message too large to frame")
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a 2-byte big-endian length prefix from r followed by that
+// many bytes.
+func readFrame(r io.Reader) ([]byte, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Handshake performs a CPace exchange authenticated by password over conn,
+// framing msgA and msgB with a 2-byte big-endian length prefix, and returns
+// the derived shared secret key.
+//
+// role must be RoleInitiator on one side and RoleResponder on the other; c
+// must match on both sides for the two peers to derive the same key.
+func Handshake(conn io.ReadWriter, role Role, password string, c *ContextInfo) ([]byte, error) {
+	switch role {
+	case RoleInitiator:
+		msgA, s, err := Start(password, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(conn, msgA); err != nil {
+			return nil, err
+		}
+		msgB, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		return s.Finish(msgB)
+
+	case RoleResponder:
+		msgA, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		msgB, key, err := Exchange(password, c, msgA)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(conn, msgB); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	panic("cpace: unreachable")
+}
+
+// Config configures NewConn.
+type Config struct {
+	// Role must be RoleInitiator on one side and RoleResponder on the other.
+	Role Role
+	// Password is the shared password authenticating the exchange.
+	Password string
+	// Context must match on both sides for the two peers to derive the same
+	// key.
+	Context *ContextInfo
+}
+
+// Conn is a net.Conn that performs a CPace exchange on creation and then
+// transports all data wrapped in an authenticated ChaCha20-Poly1305 channel
+// keyed from the exchange's shared secret, similarly to how crypto/tls wraps
+// a net.Conn after its handshake.
+type Conn struct {
+	net.Conn
+
+	writeAEAD cipher.AEAD
+	writeSeq  uint64
+
+	readAEAD cipher.AEAD
+	readSeq  uint64
+	readBuf  []byte
+}
+
+// NewConn performs a CPace exchange over conn as configured by cfg, and
+// returns a Conn that encrypts and authenticates all further traffic with a
+// key derived from the exchange.
+//
+// Like Handshake, exactly one peer should use RoleInitiator and the other
+// RoleResponder, with a matching Password and Context.
+func NewConn(conn net.Conn, cfg *Config) (*Conn, error) {
+	key, err := Handshake(conn, cfg.Role, cfg.Password, cfg.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	initiatorKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, key, []byte("cpace conn initiator")), initiatorKey); err != nil {
+		return nil, err
+	}
+	responderKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, key, []byte("cpace conn responder")), responderKey); err != nil {
+		return nil, err
+	}
+
+	writeKey, readKey := initiatorKey, responderKey
+	if cfg.Role == RoleResponder {
+		writeKey, readKey = responderKey, initiatorKey
+	}
+
+	writeAEAD, err := chacha20poly1305.New(writeKey)
+	if err != nil {
+		return nil, err
+	}
+	readAEAD, err := chacha20poly1305.New(readKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{Conn: conn, writeAEAD: writeAEAD, readAEAD: readAEAD}, nil
+}
+
+func nonce(seq uint64) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
+
+// poly1305TagSize is the size of the Poly1305 authentication tag appended by
+// chacha20poly1305.Seal, i.e. the difference between a ciphertext and its
+// plaintext.
+const poly1305TagSize = 16
+
+const maxPlaintextLen = maxFrameLen - poly1305TagSize
+
+// Write implements net.Conn, encrypting and authenticating p before sending
+// it over the underlying connection in one or more length-prefixed records.
+func (c *Conn) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxPlaintextLen {
+			chunk = chunk[:maxPlaintextLen]
+		}
+
+		sealed := c.writeAEAD.Seal(nil, nonce(c.writeSeq), chunk, nil)
+		c.writeSeq++
+		if err := writeFrame(c.Conn, sealed); err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Read implements net.Conn, copying into p any plaintext left over from the
+// last record, or else reading and decrypting one new record from the
+// underlying connection. It reads at most one record per call.
+func (c *Conn) Read(p []byte) (n int, err error) {
+	if len(c.readBuf) == 0 {
+		sealed, err := readFrame(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		plain, err := c.readAEAD.Open(sealed[:0], nonce(c.readSeq), sealed, nil)
+		if err != nil {
+			return 0, errors.New("cpace: message authentication failed")
+		}
+		c.readSeq++
+		c.readBuf = plain
+	}
+
+	n = copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
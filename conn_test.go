@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"filippo.io/cpace"
+)
+
+func TestHandshake(t *testing.T) {
+	connA, connB := net.Pipe()
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	keyCh := make(chan []byte, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		key, err := cpace.Handshake(connB, cpace.RoleResponder, "password", c)
+		keyCh <- key
+		errCh <- err
+	}()
+
+	keyA, err := cpace.Handshake(connA, cpace.RoleInitiator, "password", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB := <-keyCh
+	err = <-errCh
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(keyA, keyB) {
+		t.Error("keys were not equal")
+	}
+}
+
+func TestConn(t *testing.T) {
+	connA, connB := net.Pipe()
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	serverCh := make(chan *cpace.Conn, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		server, err := cpace.NewConn(connB, &cpace.Config{
+			Role: cpace.RoleResponder, Password: "password", Context: c,
+		})
+		serverCh <- server
+		errCh <- err
+	}()
+
+	client, err := cpace.NewConn(connA, &cpace.Config{
+		Role: cpace.RoleInitiator, Password: "password", Context: c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-serverCh
+	err = <-errCh
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("hello, authenticated world")
+	writeErrCh := make(chan error, 1)
+	go func() {
+		_, err := client.Write(msg)
+		writeErrCh <- err
+	}()
+
+	got := make([]byte, len(msg))
+	if _, err := server.Read(got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-writeErrCh; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q, expected %q", got, msg)
+	}
+}
+
+func TestConnWrongPassword(t *testing.T) {
+	connA, connB := net.Pipe()
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	serverCh := make(chan *cpace.Conn, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		server, err := cpace.NewConn(connB, &cpace.Config{
+			Role: cpace.RoleResponder, Password: "wrong", Context: c,
+		})
+		serverCh <- server
+		errCh <- err
+	}()
+
+	client, err := cpace.NewConn(connA, &cpace.Config{
+		Role: cpace.RoleInitiator, Password: "password", Context: c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-serverCh
+	err = <-errCh
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeErrCh := make(chan error, 1)
+	go func() {
+		_, err := client.Write([]byte("hello"))
+		writeErrCh <- err
+	}()
+
+	got := make([]byte, 5)
+	if _, err := server.Read(got); err == nil {
+		t.Error("expected authentication failure for mismatched passwords")
+	}
+	<-writeErrCh
+}
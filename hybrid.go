@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"golang.org/x/crypto/hkdf"
+)
+
+// DefaultKEM is the post-quantum KEM used by StartHybrid and ExchangeHybrid
+// when no kem.Scheme is otherwise specified.
+var DefaultKEM = kyber768.Scheme()
+
+// StartHybrid is like Start, but additionally runs a key encapsulation
+// mechanism alongside CPace, to hedge against future attacks on ristretto255
+// from a quantum computer.
+//
+// msgA is the concatenation of the CPace message and the freshly generated
+// KEM public key. The two are not individually length-prefixed: their sizes
+// are fixed by scheme and can be recovered from it. The KEM public key is
+// folded into the CPace transcript, so the HMAC key derivation in
+// FinishHybrid depends on it, just like it depends on the rest of msgA.
+//
+// If scheme is nil, DefaultKEM is used. scheme must be the same on both
+// peers, in addition to password and c.
+func StartHybrid(password string, c *ContextInfo, scheme kem.Scheme) (msgA []byte, s *State, err error) {
+	if scheme == nil {
+		scheme = DefaultKEM
+	}
+
+	msgA, s, err = Start(password, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pk, sk, err := scheme.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.kemScheme = scheme
+	s.kemPrivateKey = sk
+	s.transcript = append(s.transcript, pkBytes...)
+
+	return append(msgA, pkBytes...), s, nil
+}
+
+// ExchangeHybrid is like Exchange, but completes the KEM started by
+// StartHybrid in addition to the CPace exchange, and combines the two shared
+// secrets into the returned key, so it remains secure as long as either
+// primitive holds.
+//
+// msgA is the message produced by StartHybrid, and msgB is the concatenation
+// of the CPace message and the KEM ciphertext, to be passed to
+// (*State).FinishHybrid. Both the KEM public key (part of msgA) and the KEM
+// ciphertext (part of msgB) are folded into the CPace transcript, so the HMAC
+// key derivation depends on the whole hybrid exchange, not just its CPace half.
+//
+// If scheme is nil, DefaultKEM is used. scheme must be the same on both
+// peers, in addition to password and c.
+func ExchangeHybrid(password string, c *ContextInfo, msgA []byte, scheme kem.Scheme) (msgB, key []byte, err error) {
+	if scheme == nil {
+		scheme = DefaultKEM
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(msgA) != 16+32+scheme.PublicKeySize() {
+		return nil, nil, errors.New("cpace: invalid peer message")
+	}
+	salt, encodedA, pkBytes := msgA[:16], msgA[16:16+32], msgA[16+32:]
+
+	secret, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	x := secretGenerator(password, salt, c)
+	x.ScalarMult(secret, x)
+	cpaceMsgB := x.Encode(nil)
+
+	pk, err := scheme.UnmarshalBinaryPublicKey(pkBytes)
+	if err != nil {
+		return nil, nil, errors.New("cpace: invalid peer message")
+	}
+	ct, ss, err := scheme.Encapsulate(pk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transcript := make([]byte, 0, len(msgA)+len(cpaceMsgB)+len(ct))
+	transcript = append(transcript, msgA...)
+	transcript = append(transcript, cpaceMsgB...)
+	transcript = append(transcript, ct...)
+
+	cpaceKey, err := deriveKey(encodedA, transcript, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key = combineSecrets(cpaceKey, ss)
+
+	return append(cpaceMsgB, ct...), key, nil
+}
+
+// FinishHybrid is like (*State).Finish, but completes the KEM started by
+// StartHybrid, and combines the two shared secrets into the returned key, so
+// it remains secure as long as either primitive holds.
+//
+// msgB is the message produced by ExchangeHybrid.
+func (s *State) FinishHybrid(msgB []byte) (key []byte, err error) {
+	if s.kemScheme == nil {
+		return nil, errors.New("cpace: FinishHybrid called on a non-hybrid State")
+	}
+
+	if len(msgB) != 32+s.kemScheme.CiphertextSize() {
+		return nil, errors.New("cpace: invalid peer message")
+	}
+	cpaceMsgB, ct := msgB[:32], msgB[32:]
+
+	// s.transcript already holds msgA (including the KEM public key, folded
+	// in by StartHybrid); append msgB (including the KEM ciphertext) so it
+	// matches the transcript computed by ExchangeHybrid.
+	transcript := append(s.transcript, msgB...)
+	cpaceKey, err := deriveKey(cpaceMsgB, transcript, s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := s.kemScheme.Decapsulate(s.kemPrivateKey, ct)
+	if err != nil {
+		return nil, errors.New("cpace: invalid peer message")
+	}
+
+	return combineSecrets(cpaceKey, ss), nil
+}
+
+// combineSecrets binds the CPace and KEM shared secrets together with
+// HKDF-Extract, using the CPace key as salt and the KEM shared secret as
+// input keying material, so the result is secure as long as either secret is.
+func combineSecrets(cpaceKey, kemSecret []byte) []byte {
+	return hkdf.Extract(sha256.New, kemSecret, cpaceKey)
+}
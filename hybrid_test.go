@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace_test
+
+import (
+	"bytes"
+	"testing"
+
+	"filippo.io/cpace"
+)
+
+func TestHybrid(t *testing.T) {
+	password := "password"
+	c := cpace.NewContextInfo("a", "b", []byte("ad"))
+
+	msgA, s, err := cpace.StartHybrid(password, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgB, keyB, err := cpace.ExchangeHybrid(password, c, msgA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyA, err := s.FinishHybrid(msgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(keyA, keyB) {
+		t.Error("keys were not equal")
+	}
+}
+
+func TestHybridMismatchedPassword(t *testing.T) {
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	msgA, s, err := cpace.StartHybrid("password", c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgB, keyB, err := cpace.ExchangeHybrid("wrong", c, msgA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyA, err := s.FinishHybrid(msgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(keyA, keyB) {
+		t.Error("expected different keys for mismatched passwords")
+	}
+}
+
+func TestHybridBrokenMessages(t *testing.T) {
+	password := "password"
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	msgA, s, err := cpace.StartHybrid(password, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := cpace.ExchangeHybrid(password, c, msgA[:len(msgA)-1], nil); err == nil {
+		t.Error("expected error for short msgA")
+	}
+
+	msgB, _, err := cpace.ExchangeHybrid(password, c, msgA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FinishHybrid(msgB[:len(msgB)-1]); err == nil {
+		t.Error("expected error for short msgB")
+	}
+
+	if _, err := s.Finish(msgB); err == nil {
+		t.Error("expected Finish on a hybrid msgB to fail length validation")
+	}
+}
+
+func TestHybridTamperedKEMBytes(t *testing.T) {
+	password := "password"
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	msgA, s, err := cpace.StartHybrid(password, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a bit in the KEM public key appended to msgA. ExchangeHybrid
+	// doesn't reject it (it's just bytes to the KEM), but it now runs
+	// against a different key, so the two sides should end up with
+	// different keys rather than silently agreeing.
+	tamperedMsgA := append([]byte(nil), msgA...)
+	tamperedMsgA[len(tamperedMsgA)-1] ^= 0xff
+	msgB, keyB, err := cpace.ExchangeHybrid(password, c, tamperedMsgA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyA, err := s.FinishHybrid(msgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyA, keyB) {
+		t.Error("expected different keys after tampering with the KEM public key in msgA")
+	}
+
+	// Same, but flipping a bit in the KEM ciphertext appended to msgB.
+	msgA, s, err = cpace.StartHybrid(password, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgB, keyB, err = cpace.ExchangeHybrid(password, c, msgA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedMsgB := append([]byte(nil), msgB...)
+	tamperedMsgB[len(tamperedMsgB)-1] ^= 0xff
+	keyA, err = s.FinishHybrid(tamperedMsgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyA, keyB) {
+		t.Error("expected different keys after tampering with the KEM ciphertext in msgB")
+	}
+}
+
+func TestFinishHybridOnPlainState(t *testing.T) {
+	password := "password"
+	c := cpace.NewContextInfo("a", "b", nil)
+
+	msgA, s, err := cpace.Start(password, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgB, _, err := cpace.Exchange(password, c, msgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FinishHybrid(msgB); err == nil {
+		t.Error("expected error calling FinishHybrid on a non-hybrid State")
+	}
+}
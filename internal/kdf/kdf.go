@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package kdf implements the Argon2id and scrypt password hardening used by
+// both the cpace and spake2plus packages, including their shared default
+// parameters, so the two copies can't drift apart.
+package kdf
+
+import (
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Argon2id hardens password under salt with Argon2id. A zero time, memory, or
+// threads is replaced with the package's conservative default.
+func Argon2id(password string, salt []byte, time, memory uint32, threads uint8) []byte {
+	if time == 0 {
+		time = 1
+	}
+	if memory == 0 {
+		memory = 64 * 1024
+	}
+	if threads == 0 {
+		threads = 4
+	}
+	return argon2.IDKey([]byte(password), salt, time, memory, threads, 32)
+}
+
+// Scrypt hardens password under salt with scrypt. A zero n, r, or p is
+// replaced with the package's conservative default.
+func Scrypt(password string, salt []byte, n, r, p int) ([]byte, error) {
+	if n == 0 {
+		n = 1 << 15
+	}
+	if r == 0 {
+		r = 8
+	}
+	if p == 0 {
+		p = 1
+	}
+	return scrypt.Key([]byte(password), salt, n, r, p, 32)
+}
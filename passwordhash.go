@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace
+
+import (
+	"filippo.io/cpace/internal/kdf"
+)
+
+// PasswordHash hardens a password before it is mapped to the CPace generator,
+// so that an offline attacker who obtains a transcript has to pay the cost of
+// the hash for every guess, rather than hashing the password directly. Set it
+// with (*ContextInfo).SetPasswordHash.
+type PasswordHash interface {
+	// Hash returns hardened key material for password under salt. salt is
+	// derived by the caller from the ContextInfo, so it does not need to be
+	// transmitted or agreed on separately.
+	Hash(password string, salt []byte) []byte
+}
+
+// PlainHash passes the password through unchanged. It is the default, and
+// preserves the behavior of versions of this package predating PasswordHash:
+// it offers no offline-attack hardening, and should only be selected where
+// that is acceptable, or where interoperability with such a peer is required.
+type PlainHash struct{}
+
+// Hash implements PasswordHash.
+func (PlainHash) Hash(password string, salt []byte) []byte {
+	return []byte(password)
+}
+
+// Argon2id hardens the password with Argon2id. The zero value uses
+// conservative default parameters.
+type Argon2id struct {
+	Time, Memory uint32
+	Threads      uint8
+}
+
+// Hash implements PasswordHash.
+func (a Argon2id) Hash(password string, salt []byte) []byte {
+	return kdf.Argon2id(password, salt, a.Time, a.Memory, a.Threads)
+}
+
+// Scrypt hardens the password with scrypt. The zero value uses conservative
+// default parameters.
+type Scrypt struct {
+	N, R, P int
+}
+
+// Hash implements PasswordHash.
+func (s Scrypt) Hash(password string, salt []byte) []byte {
+	key, err := kdf.Scrypt(password, salt, s.N, s.R, s.P)
+	if err != nil {
+		// Only N, r, p validation can fail, and they are either the defaults
+		// from internal/kdf or caller-supplied constants.
+		panic("cpace: invalid scrypt parameters: " + err.Error())
+	}
+	return key
+}
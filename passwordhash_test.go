@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package cpace_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"filippo.io/cpace"
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestTranscriptWithPasswordHash(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Hash     cpace.PasswordHash
+		Expected string
+	}{
+		{
+			Name:     "Argon2id",
+			Hash:     cpace.Argon2id{Time: 1, Memory: 8 * 1024, Threads: 1},
+			Expected: "R2eIg+2d+gAr/pAX4eVnASW3kBAily86Ejfpywu2Ypg",
+		},
+		{
+			Name:     "Scrypt",
+			Hash:     cpace.Scrypt{N: 1 << 10, R: 8, P: 1},
+			Expected: "14ydVFmPkgXjAHCGHywCebJJOwznDEzTPKRo1QrAff0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			// Don't try this at home.
+			defer func(original io.Reader) { rand.Reader = original }(rand.Reader)
+			rand.Reader = hkdf.Expand(sha256.New, []byte("INSECURE"), nil)
+
+			password := "password"
+			c := cpace.NewContextInfo("a", "b", []byte("ad"))
+			c.SetPasswordHash(tt.Hash)
+
+			tx := sha256.New()
+
+			msgA, s, err := cpace.Start(password, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.Write(msgA)
+
+			msgB, key, err := cpace.Exchange(password, c, msgA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.Write(msgB)
+			tx.Write(key)
+
+			if keyA, err := s.Finish(msgB); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(key, keyA) {
+				t.Error("keys were not equal")
+			}
+
+			if h := base64.RawStdEncoding.EncodeToString(tx.Sum(nil)); h != tt.Expected {
+				t.Errorf("transcript hash changed: got %q, expected %q", h, tt.Expected)
+			}
+		})
+	}
+}
+
+func TestPasswordHashMismatch(t *testing.T) {
+	password := "password"
+	cA := cpace.NewContextInfo("a", "b", nil)
+	cA.SetPasswordHash(cpace.Argon2id{Time: 1, Memory: 8 * 1024, Threads: 1})
+	cB := cpace.NewContextInfo("a", "b", nil)
+	cB.SetPasswordHash(cpace.Scrypt{N: 1 << 10, R: 8, P: 1})
+
+	msgA, s, err := cpace.Start(password, cA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgB, keyB, err := cpace.Exchange(password, cB, msgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyA, err := s.Finish(msgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(keyA, keyB) {
+		t.Error("expected different keys for mismatched PasswordHash choices")
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package spake2plus implements the SPAKE2+ augmented PAKE, instantiated with
+// the ristretto255 group.
+//
+// Unlike cpace, which is a balanced PAKE where both peers need to know the
+// password plaintext, SPAKE2+ is an augmented PAKE: the server only needs to
+// store a password-derived verifier produced by Register, so a server
+// compromise does not immediately hand over the client's password.
+//
+// This implementation is loosely based on draft-irtf-cfrg-spake2-08, with
+// ristretto255 swapped in for the group, and the transcript hashing and
+// context handling borrowed from the sibling cpace package.
+package spake2plus
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"io"
+
+	"filippo.io/cpace/internal/kdf"
+	"github.com/gtank/ristretto255"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ContextInfo captures the additional connection information that the two
+// peers need to agree on for the key to be the same. It plays the same role
+// as cpace.ContextInfo.
+type ContextInfo struct {
+	idA, idB string
+	ad       []byte
+}
+
+// NewContextInfo returns a ContextInfo for use with Register, ClientStart, and
+// ServerExchange.
+//
+// idA represents the identity of the client (the party that uses
+// ClientStart), idB of the server (the party that uses ServerExchange). ad is
+// any additional context the two parties share, and can be nil.
+func NewContextInfo(idA, idB string, ad []byte) *ContextInfo {
+	return &ContextInfo{
+		idA: idA, idB: idB, ad: ad,
+	}
+}
+
+func (c *ContextInfo) validate() error {
+	switch {
+	case c == nil:
+		return errors.New("spake2plus: ContextInfo can't be nil")
+	case len(c.idA) >= 1<<16:
+		return errors.New("spake2plus: idA too long")
+	case len(c.idB) >= 1<<16:
+		return errors.New("spake2plus: idB too long")
+	case len(c.ad) >= 1<<16:
+		return errors.New("spake2plus: additional data too long")
+	default:
+		return nil
+	}
+}
+
+const label = "spake2plus-r255"
+
+func (c *ContextInfo) serialize() []byte {
+	b := &cryptobyte.Builder{}
+	for _, in := range [][]byte{
+		[]byte(label), []byte(c.idA), []byte(c.idB), c.ad,
+	} {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(in)
+		})
+	}
+	return b.BytesOrPanic()
+}
+
+// M and N are fixed generators, independent of the base point, derived by
+// hashing fixed labels to the group. Every SPAKE2+ ristretto255 party uses the
+// same M and N, so they are computed once here rather than per-exchange.
+var (
+	mGenerator = hashToGroup("spake2plus-r255 point M")
+	nGenerator = hashToGroup("spake2plus-r255 point N")
+)
+
+func hashToGroup(label string) *ristretto255.Element {
+	h := sha512.Sum512([]byte(label))
+	return ristretto255.NewElement().FromUniformBytes(h[:])
+}
+
+// PasswordKDF hardens a low-entropy password before it is mapped into the w0
+// and w1 scalars, so that a leaked transcript doesn't reduce to an offline
+// dictionary attack against the raw password. Register applies it with a salt
+// deterministically derived from the ContextInfo, so both parties agree on it
+// without an extra round trip.
+type PasswordKDF interface {
+	// Derive returns hardened key material for password under salt. The
+	// output is stretched internally, so any length is acceptable as long as
+	// it carries the KDF's intended work factor.
+	Derive(password string, salt []byte) []byte
+}
+
+// Argon2id hardens the password with Argon2id. The zero value uses
+// conservative default parameters.
+type Argon2id struct {
+	Time, Memory uint32
+	Threads      uint8
+}
+
+// Derive implements PasswordKDF.
+func (a Argon2id) Derive(password string, salt []byte) []byte {
+	return kdf.Argon2id(password, salt, a.Time, a.Memory, a.Threads)
+}
+
+// Scrypt hardens the password with scrypt. The zero value uses conservative
+// default parameters.
+type Scrypt struct {
+	N, R, P int
+}
+
+// Derive implements PasswordKDF.
+func (s Scrypt) Derive(password string, salt []byte) []byte {
+	key, err := kdf.Scrypt(password, salt, s.N, s.R, s.P)
+	if err != nil {
+		// Only N, r, p validation can fail, and they are either the
+		// defaults from internal/kdf or caller-supplied constants.
+		panic("spake2plus: invalid scrypt parameters: " + err.Error())
+	}
+	return key
+}
+
+func deriveScalars(password string, c *ContextInfo, kdf PasswordKDF) (w0, w1 *ristretto255.Scalar) {
+	if kdf == nil {
+		kdf = Argon2id{}
+	}
+	salt := c.serialize()
+	hardened := kdf.Derive(password, salt)
+
+	b := make([]byte, 64)
+	h := hkdf.Expand(sha256.New, hardened, []byte("spake2plus-r255 w0"))
+	io.ReadFull(h, b)
+	w0 = ristretto255.NewScalar().FromUniformBytes(b)
+
+	b = make([]byte, 64)
+	h = hkdf.Expand(sha256.New, hardened, []byte("spake2plus-r255 w1"))
+	io.ReadFull(h, b)
+	w1 = ristretto255.NewScalar().FromUniformBytes(b)
+
+	return w0, w1
+}
+
+// Register derives the long-term password-based values for a client/server
+// pair. w0 and w1 are needed by the client for every run of ClientStart, and
+// can either be stored or re-derived from password on each use. Only w0 and L
+// should be stored by the server: L lets the server participate without ever
+// holding (or being able to derive) w1, and hence the password.
+//
+// kdf hardens password against offline attacks; if nil, Argon2id{} is used.
+func Register(password string, c *ContextInfo, kdf PasswordKDF) (w0, w1 *ristretto255.Scalar, L *ristretto255.Element, err error) {
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	w0, w1 = deriveScalars(password, c, kdf)
+	L = ristretto255.NewElement().ScalarBaseMult(w1)
+	return w0, w1, L, nil
+}
+
+func randomScalar() (*ristretto255.Scalar, error) {
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return ristretto255.NewScalar().FromUniformBytes(b), nil
+}
+
+// ClientSession is a SPAKE2+ exchange in progress on the client side, waiting
+// for the server's response.
+type ClientSession struct {
+	c      *ContextInfo
+	w0, w1 *ristretto255.Scalar
+	x      *ristretto255.Scalar
+	msgA   []byte
+}
+
+// ClientStart initiates a SPAKE2+ exchange as the client, using the w0 and w1
+// values from Register. msgA should be sent to the server, to be processed by
+// ServerExchange, and s used to process the server's response.
+func ClientStart(w0, w1 *ristretto255.Scalar, c *ContextInfo) (msgA []byte, s *ClientSession, err error) {
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	x, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	X := ristretto255.NewElement().ScalarBaseMult(x)
+	X.Add(X, ristretto255.NewElement().ScalarMult(w0, mGenerator))
+
+	msgA = X.Encode(nil)
+
+	return msgA, &ClientSession{c: c, w0: w0, w1: w1, x: x, msgA: msgA}, nil
+}
+
+// ServerSession is a SPAKE2+ exchange in progress on the server side, waiting
+// for the client's confirmation.
+type ServerSession struct {
+	c          *ContextInfo
+	msgA, msgB []byte
+	key        []byte
+	macA       []byte
+}
+
+// ServerExchange processes msgA generated by ClientStart, using the w0 and L
+// values stored from Register, and returns msgB and confirmB, to be sent to
+// the client, as well as the ServerSession used to process the client's
+// confirmation.
+func ServerExchange(w0 *ristretto255.Scalar, L *ristretto255.Element, c *ContextInfo, msgA []byte) (msgB, confirmB []byte, s *ServerSession, err error) {
+	if err := c.validate(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	X := ristretto255.NewElement()
+	if err := X.Decode(msgA); err != nil {
+		return nil, nil, nil, errors.New("spake2plus: invalid peer message")
+	}
+
+	y, err := randomScalar()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	Y := ristretto255.NewElement().ScalarBaseMult(y)
+	Y.Add(Y, ristretto255.NewElement().ScalarMult(w0, nGenerator))
+	msgB = Y.Encode(nil)
+
+	// Xw = X - w0*M, the client's contribution with the password blinding
+	// removed.
+	Xw := ristretto255.NewElement().Subtract(X,
+		ristretto255.NewElement().ScalarMult(w0, mGenerator))
+	if Xw.Equal(identity) == 1 {
+		return nil, nil, nil, errors.New("spake2plus: invalid peer message")
+	}
+
+	Z := ristretto255.NewElement().ScalarMult(y, Xw)
+	V := ristretto255.NewElement().ScalarMult(y, L)
+
+	key, macA, macB := deriveKeys(c, msgA, msgB, Z, V, w0)
+	confirmB = appendConfirm(macB, c, msgA, msgB)
+
+	return msgB, confirmB, &ServerSession{c: c, msgA: msgA, msgB: msgB, key: key, macA: macA}, nil
+}
+
+var identity = ristretto255.NewElement()
+
+func appendConfirm(macKey []byte, c *ContextInfo, msgA, msgB []byte) []byte {
+	h := hmac.New(sha256.New, macKey)
+	h.Write(c.serialize())
+	h.Write(msgA)
+	h.Write(msgB)
+	return h.Sum(nil)
+}
+
+func deriveKeys(c *ContextInfo, msgA, msgB []byte, Z, V *ristretto255.Element, w0 *ristretto255.Scalar) (key, macA, macB []byte) {
+	b := &cryptobyte.Builder{}
+	for _, in := range [][]byte{
+		c.serialize(), msgA, msgB, Z.Encode(nil), V.Encode(nil), w0.Encode(nil),
+	} {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(in)
+		})
+	}
+	transcriptHash := sha256.Sum256(b.BytesOrPanic())
+
+	out := make([]byte, 96)
+	h := hkdf.New(sha256.New, transcriptHash[:], nil, []byte("spake2plus-r255 derive"))
+	io.ReadFull(h, out)
+
+	return out[:32], out[32:64], out[64:96]
+}
+
+// Finish processes the server's response, generated by ServerExchange,
+// verifies the server's confirmation message, and returns the shared secret
+// key and the client's own confirmation message, to be sent to the server and
+// processed by (*ServerSession).Finish.
+//
+// An error is returned if msgB is malformed or if confirmB doesn't match: in
+// either case, the two parties don't share the same password, or the
+// exchange was tampered with, and key is not returned.
+func (s *ClientSession) Finish(msgB, confirmB []byte) (key, confirmA []byte, err error) {
+	Y := ristretto255.NewElement()
+	if err := Y.Decode(msgB); err != nil {
+		return nil, nil, errors.New("spake2plus: invalid peer message")
+	}
+
+	Yw := ristretto255.NewElement().Subtract(Y,
+		ristretto255.NewElement().ScalarMult(s.w0, nGenerator))
+	if Yw.Equal(identity) == 1 {
+		return nil, nil, errors.New("spake2plus: invalid peer message")
+	}
+
+	Z := ristretto255.NewElement().ScalarMult(s.x, Yw)
+	V := ristretto255.NewElement().ScalarMult(s.w1, Yw)
+
+	key, macA, macB := deriveKeys(s.c, s.msgA, msgB, Z, V, s.w0)
+
+	if !hmac.Equal(confirmB, appendConfirm(macB, s.c, s.msgA, msgB)) {
+		return nil, nil, errors.New("spake2plus: server confirmation mismatch")
+	}
+
+	confirmA = appendConfirm(macA, s.c, s.msgA, msgB)
+	return key, confirmA, nil
+}
+
+// Finish verifies the client's confirmation message, generated by
+// (*ClientSession).Finish, and returns the shared secret key.
+//
+// An error is returned if confirmA doesn't match, in which case the two
+// parties don't share the same password, or the exchange was tampered with,
+// and key is not returned.
+func (s *ServerSession) Finish(confirmA []byte) (key []byte, err error) {
+	if !hmac.Equal(confirmA, appendConfirm(s.macA, s.c, s.msgA, s.msgB)) {
+		return nil, errors.New("spake2plus: client confirmation mismatch")
+	}
+	return s.key, nil
+}
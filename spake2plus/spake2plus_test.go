@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package spake2plus_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"filippo.io/cpace/spake2plus"
+)
+
+func Example() {
+	password := "password"
+	c := spake2plus.NewContextInfo("192.0.2.1:12345", "192.0.2.2:42", nil)
+
+	// Registration happens once, ahead of time; only w0 and L are stored
+	// server-side.
+	w0, w1, L, err := spake2plus.Register(password, c, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	msgA, client, err := spake2plus.ClientStart(w0, w1, c)
+	if err != nil {
+		panic(err)
+	}
+
+	msgB, confirmB, server, err := spake2plus.ServerExchange(w0, L, c, msgA)
+	if err != nil {
+		panic(err)
+	}
+
+	keyA, confirmA, err := client.Finish(msgB, confirmB)
+	if err != nil {
+		panic(err)
+	}
+
+	keyB, err := server.Finish(confirmA)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("keyA == keyB:", bytes.Equal(keyA, keyB))
+	// Output: keyA == keyB: true
+}
+
+func TestScrypt(t *testing.T) {
+	password := "password"
+	c := spake2plus.NewContextInfo("a", "b", []byte("ad"))
+	kdf := spake2plus.Scrypt{N: 1 << 10, R: 8, P: 1}
+
+	w0, w1, L, err := spake2plus.Register(password, c, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgA, client, err := spake2plus.ClientStart(w0, w1, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgB, confirmB, server, err := spake2plus.ServerExchange(w0, L, c, msgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyA, confirmA, err := client.Finish(msgB, confirmB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyB, err := server.Finish(confirmA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(keyA, keyB) {
+		t.Error("keys were not equal")
+	}
+}
+
+func TestMismatchedPasswords(t *testing.T) {
+	c := spake2plus.NewContextInfo("a", "b", nil)
+
+	w0A, w1A, _, err := spake2plus.Register("password", c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w0B, _, L, err := spake2plus.Register("wrong-password", c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgA, client, err := spake2plus.ClientStart(w0A, w1A, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgB, confirmB, _, err := spake2plus.ServerExchange(w0B, L, c, msgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.Finish(msgB, confirmB); err == nil {
+		t.Error("expected error for mismatched passwords")
+	}
+}
+
+func TestBrokenMessages(t *testing.T) {
+	password := "password"
+	c := spake2plus.NewContextInfo("192.0.2.1:12345", "192.0.2.2:42", nil)
+
+	w0, w1, L, err := spake2plus.Register(password, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgA, client, err := spake2plus.ClientStart(w0, w1, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := spake2plus.ServerExchange(w0, L, c, msgA[:len(msgA)-1]); err == nil {
+		t.Error("expected error for short msgA")
+	}
+	msgA[len(msgA)-1] ^= 0xff
+	if _, _, _, err := spake2plus.ServerExchange(w0, L, c, msgA); err == nil {
+		t.Error("expected error for modified msgA")
+	}
+	msgA[len(msgA)-1] ^= 0xff
+
+	msgB, confirmB, _, err := spake2plus.ServerExchange(w0, L, c, msgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.Finish(msgB[:len(msgB)-1], confirmB); err == nil {
+		t.Error("expected error for short msgB")
+	}
+	msgB[len(msgB)-1] ^= 0xff
+	if _, _, err := client.Finish(msgB, confirmB); err == nil {
+		t.Error("expected error for modified msgB")
+	}
+	msgB[len(msgB)-1] ^= 0xff
+
+	confirmB[0] ^= 0xff
+	if _, _, err := client.Finish(msgB, confirmB); err == nil {
+		t.Error("expected error for modified confirmB")
+	}
+	confirmB[0] ^= 0xff
+}
+
+func TestLargeContextValues(t *testing.T) {
+	password := "password"
+	validC := spake2plus.NewContextInfo(string(make([]byte, 1<<16-1)), "b", nil)
+	badC := spake2plus.NewContextInfo(string(make([]byte, 1<<16)), "b", nil)
+
+	if _, _, _, err := spake2plus.Register(password, validC, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := spake2plus.Register(password, badC, nil); err == nil {
+		t.Error("expected error for long context value")
+	}
+}